@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/equalitie/deflect-geoip/internal/rir"
+)
+
+// Delta describes an incremental diff between two published releases,
+// letting bandwidth-constrained consumers avoid re-downloading the full
+// countrydb.csv.gz for every version.
+type Delta struct {
+	FromVersion string `json:"from_version"`
+	Path        string `json:"path"`
+	Sha256      string `json:"sha256"`
+	Bytes       int64  `json:"bytes"`
+}
+
+// deltaOp is one line of a deltas/<prev>..<new>.jsonl.gz file.
+type deltaOp struct {
+	Op      string `json:"op"` // "add", "del", or "chg"
+	Prefix  string `json:"prefix"`
+	Country string `json:"country,omitempty"` // set for "add"
+	From    string `json:"from,omitempty"`    // set for "chg"
+	To      string `json:"to,omitempty"`      // set for "chg"
+}
+
+// buildDelta fetches releases/<prev>/countrydb.csv.gz from prevSource
+// (a local directory or a base URL, resolved the same way as the
+// "verify" subcommand's -source), verifies it against its sha256
+// sidecar, diffs it against newRecs, and writes
+// deltas/<prev>..<version>.jsonl.gz to outDir.
+func buildDelta(outDir, prevSource, prev, version string, newRecs []rir.Record) Delta {
+	prevRel := fmt.Sprintf("releases/%s/countrydb.csv.gz", prev)
+	prevRaw := fetchRelease(prevSource, prevRel)
+
+	shaLine := fetchRelease(prevSource, prevRel+".sha256")
+	wantSha := strings.Fields(string(shaLine))[0]
+
+	sum := sha256.Sum256(prevRaw)
+	if got := hex.EncodeToString(sum[:]); got != wantSha {
+		panic(fmt.Sprintf("sha256 mismatch for %s: got %s want %s", prevRel, got, wantSha))
+	}
+
+	prevRecs, err := parseCSVGZ(prevRaw)
+	must(err)
+
+	ops := diffRecords(prevRecs, newRecs)
+
+	deltaDir := filepath.Join(outDir, "deltas")
+	must(os.MkdirAll(deltaDir, 0o755))
+
+	name := fmt.Sprintf("%s..%s.jsonl.gz", prev, version)
+	deltaBytes, deltaSha := writeDeltaJSONLGZ(filepath.Join(deltaDir, name), ops)
+
+	return Delta{
+		FromVersion: prev,
+		Path:        fmt.Sprintf("deltas/%s", name),
+		Sha256:      deltaSha,
+		Bytes:       deltaBytes,
+	}
+}
+
+// diffRecords compares two sorted-by-prefix snapshots and returns the
+// ops needed to turn prevRecs into newRecs, ordered by prefix.
+func diffRecords(prevRecs, newRecs []rir.Record) []deltaOp {
+	prevByPrefix := make(map[string]string, len(prevRecs))
+	for _, r := range prevRecs {
+		prevByPrefix[r.Prefix] = r.Country
+	}
+	newByPrefix := make(map[string]string, len(newRecs))
+	for _, r := range newRecs {
+		newByPrefix[r.Prefix] = r.Country
+	}
+
+	var ops []deltaOp
+	for prefix, newCountry := range newByPrefix {
+		oldCountry, existed := prevByPrefix[prefix]
+		switch {
+		case !existed:
+			ops = append(ops, deltaOp{Op: "add", Prefix: prefix, Country: newCountry})
+		case oldCountry != newCountry:
+			ops = append(ops, deltaOp{Op: "chg", Prefix: prefix, From: oldCountry, To: newCountry})
+		}
+	}
+	for prefix := range prevByPrefix {
+		if _, ok := newByPrefix[prefix]; !ok {
+			ops = append(ops, deltaOp{Op: "del", Prefix: prefix})
+		}
+	}
+
+	sort.Slice(ops, func(i, j int) bool { return ops[i].Prefix < ops[j].Prefix })
+	return ops
+}
+
+func writeDeltaJSONLGZ(path string, ops []deltaOp) (int64, string) {
+	f, err := os.Create(path)
+	must(err)
+	defer f.Close()
+
+	h := sha256.New()
+	mw := io.MultiWriter(f, h)
+	gw := gzip.NewWriter(mw)
+
+	enc := json.NewEncoder(gw)
+	for _, op := range ops {
+		must(enc.Encode(op))
+	}
+	must(gw.Close())
+
+	st, err := os.Stat(path)
+	must(err)
+	return st.Size(), hex.EncodeToString(h.Sum(nil))
+}
+
+// parseCSVGZ reads back a countrydb.csv.gz file produced by writeCSVGZ.
+func parseCSVGZ(raw []byte) ([]rir.Record, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	var out []rir.Record
+	sc := bufio.NewScanner(gr)
+	first := true
+	for sc.Scan() {
+		if first {
+			first = false
+			continue // header: prefix,country
+		}
+		parts := strings.SplitN(sc.Text(), ",", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		out = append(out, rir.Record{Prefix: parts[0], Country: parts[1]})
+	}
+	return out, sc.Err()
+}
+
+// readDeltaJSONLGZ reads back a deltas/<prev>..<new>.jsonl.gz file.
+func readDeltaJSONLGZ(raw []byte) ([]deltaOp, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	var out []deltaOp
+	dec := json.NewDecoder(gr)
+	for dec.More() {
+		var op deltaOp
+		if err := dec.Decode(&op); err != nil {
+			return nil, err
+		}
+		out = append(out, op)
+	}
+	return out, nil
+}
+
+// runApplyDelta implements the "apply-delta" subcommand: reconstruct a
+// target countrydb.csv.gz from a base release plus a delta file.
+func runApplyDelta(args []string) {
+	fs := flag.NewFlagSet("apply-delta", flag.ExitOnError)
+	base := fs.String("base", "", "path to the base countrydb.csv.gz")
+	delta := fs.String("delta", "", "path to the deltas/<prev>..<new>.jsonl.gz file")
+	out := fs.String("out", "countrydb.csv.gz", "path to write the reconstructed countrydb.csv.gz")
+	must(fs.Parse(args))
+
+	if *base == "" || *delta == "" {
+		fmt.Fprintln(os.Stderr, "apply-delta: both -base and -delta are required")
+		os.Exit(2)
+	}
+
+	baseRaw, err := os.ReadFile(*base)
+	must(err)
+	baseRecs, err := parseCSVGZ(baseRaw)
+	must(err)
+
+	deltaRaw, err := os.ReadFile(*delta)
+	must(err)
+	ops, err := readDeltaJSONLGZ(deltaRaw)
+	must(err)
+
+	byPrefix := make(map[string]string, len(baseRecs))
+	for _, r := range baseRecs {
+		byPrefix[r.Prefix] = r.Country
+	}
+	for _, op := range ops {
+		switch op.Op {
+		case "add":
+			byPrefix[op.Prefix] = op.Country
+		case "del":
+			delete(byPrefix, op.Prefix)
+		case "chg":
+			byPrefix[op.Prefix] = op.To
+		default:
+			panic("apply-delta: unknown op " + op.Op)
+		}
+	}
+
+	recs := make([]rir.Record, 0, len(byPrefix))
+	for prefix, country := range byPrefix {
+		recs = append(recs, rir.Record{Prefix: prefix, Country: country})
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Prefix < recs[j].Prefix })
+
+	writeCSVGZ(*out, recs)
+	fmt.Printf("reconstructed %d records -> %s\n", len(recs), *out)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/equalitie/deflect-geoip/internal/rir"
+)
+
+func TestDiffRecords(t *testing.T) {
+	prev := []rir.Record{
+		{Prefix: "1.2.3.0/24", Country: "US"},
+		{Prefix: "4.5.6.0/24", Country: "CA"},
+		{Prefix: "7.8.9.0/24", Country: "DE"},
+	}
+	next := []rir.Record{
+		{Prefix: "1.2.3.0/24", Country: "US"},    // unchanged
+		{Prefix: "4.5.6.0/24", Country: "GB"},    // changed country
+		{Prefix: "10.11.12.0/24", Country: "FR"}, // added
+		// 7.8.9.0/24 removed
+	}
+
+	got := diffRecords(prev, next)
+	want := []deltaOp{
+		{Op: "add", Prefix: "10.11.12.0/24", Country: "FR"},
+		{Op: "chg", Prefix: "4.5.6.0/24", From: "CA", To: "GB"},
+		{Op: "del", Prefix: "7.8.9.0/24"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffRecords() = %v, want %v", got, want)
+	}
+}
+
+func TestDeltaJSONLGZRoundTrip(t *testing.T) {
+	ops := []deltaOp{
+		{Op: "add", Prefix: "10.11.12.0/24", Country: "FR"},
+		{Op: "chg", Prefix: "4.5.6.0/24", From: "CA", To: "GB"},
+		{Op: "del", Prefix: "7.8.9.0/24"},
+	}
+
+	path := filepath.Join(t.TempDir(), "delta.jsonl.gz")
+	_, sha := writeDeltaJSONLGZ(path, ops)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(raw)
+	if got := hex.EncodeToString(sum[:]); got != sha {
+		t.Fatalf("writeDeltaJSONLGZ sha256 = %s, want %s", got, sha)
+	}
+
+	got, err := readDeltaJSONLGZ(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, ops) {
+		t.Errorf("readDeltaJSONLGZ() = %v, want %v", got, ops)
+	}
+}
+
+func TestBuildDeltaAndApplyDeltaRoundTrip(t *testing.T) {
+	outDir := t.TempDir()
+
+	prevRecs := []rir.Record{
+		{Prefix: "1.2.3.0/24", Country: "US"},
+		{Prefix: "4.5.6.0/24", Country: "CA"},
+		{Prefix: "7.8.9.0/24", Country: "DE"},
+	}
+	newRecs := []rir.Record{
+		{Prefix: "1.2.3.0/24", Country: "US"},
+		{Prefix: "4.5.6.0/24", Country: "GB"},
+		{Prefix: "10.11.12.0/24", Country: "FR"},
+	}
+
+	prevReleaseDir := filepath.Join(outDir, "releases", "2024-01-01")
+	if err := os.MkdirAll(prevReleaseDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	prevGzPath := filepath.Join(prevReleaseDir, "countrydb.csv.gz")
+	_, prevSha := writeCSVGZ(prevGzPath, prevRecs)
+	if err := os.WriteFile(prevGzPath+".sha256", []byte(prevSha+"  countrydb.csv.gz\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	delta := buildDelta(outDir, outDir, "2024-01-01", "2024-02-01", newRecs)
+	if delta.FromVersion != "2024-01-01" {
+		t.Errorf("delta.FromVersion = %q, want 2024-01-01", delta.FromVersion)
+	}
+
+	deltaPath := filepath.Join(outDir, delta.Path)
+	reconstructedPath := filepath.Join(outDir, "reconstructed.csv.gz")
+	runApplyDelta([]string{
+		"-base", prevGzPath,
+		"-delta", deltaPath,
+		"-out", reconstructedPath,
+	})
+
+	raw, err := os.ReadFile(reconstructedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := parseCSVGZ(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Slice(got, func(i, j int) bool { return got[i].Prefix < got[j].Prefix })
+	want := append([]rir.Record(nil), newRecs...)
+	sort.Slice(want, func(i, j int) bool { return want[i].Prefix < want[j].Prefix })
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("apply-delta reconstruction = %v, want %v", got, want)
+	}
+}
+
+// TestBuildDeltaFetchesPrevOverHTTP covers the --prev-source case where
+// the prior release lives on a remote host rather than in the current
+// build's -out directory, e.g. a CI pipeline with no local copy of the
+// base release staged.
+func TestBuildDeltaFetchesPrevOverHTTP(t *testing.T) {
+	srcDir := t.TempDir()
+	outDir := t.TempDir()
+
+	prevRecs := []rir.Record{
+		{Prefix: "1.2.3.0/24", Country: "US"},
+	}
+	newRecs := []rir.Record{
+		{Prefix: "1.2.3.0/24", Country: "CA"},
+	}
+
+	prevReleaseDir := filepath.Join(srcDir, "releases", "2024-01-01")
+	if err := os.MkdirAll(prevReleaseDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	prevGzPath := filepath.Join(prevReleaseDir, "countrydb.csv.gz")
+	_, prevSha := writeCSVGZ(prevGzPath, prevRecs)
+	if err := os.WriteFile(prevGzPath+".sha256", []byte(prevSha+"  countrydb.csv.gz\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.FileServer(http.Dir(srcDir)))
+	defer srv.Close()
+
+	delta := buildDelta(outDir, srv.URL, "2024-01-01", "2024-02-01", newRecs)
+	if delta.FromVersion != "2024-01-01" {
+		t.Errorf("delta.FromVersion = %q, want 2024-01-01", delta.FromVersion)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(outDir, delta.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, err := readDeltaJSONLGZ(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []deltaOp{{Op: "chg", Prefix: "1.2.3.0/24", From: "US", To: "CA"}}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("buildDelta over HTTP ops = %v, want %v", ops, want)
+	}
+}
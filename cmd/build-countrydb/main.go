@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -13,17 +14,24 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
+	"github.com/equalitie/deflect-geoip/internal/mmdb"
+	"github.com/equalitie/deflect-geoip/internal/overrides"
 	"github.com/equalitie/deflect-geoip/internal/rir"
+	"github.com/equalitie/deflect-geoip/internal/sign"
 )
 
 type Latest struct {
-	Name        string     `json:"name"`
-	Version     string     `json:"version"`
-	GeneratedAt time.Time  `json:"generated_at"`
-	Sources     []string   `json:"sources"`
-	Artifacts   []Artifact `json:"artifacts"`
+	Name        string               `json:"name"`
+	Version     string               `json:"version"`
+	GeneratedAt time.Time            `json:"generated_at"`
+	Sources     []SourceInfo         `json:"sources"`
+	Artifacts   []Artifact           `json:"artifacts"`
+	Deltas      []Delta              `json:"deltas,omitempty"`
+	Signature   *sign.Signature      `json:"signature,omitempty"`
+	Overrides   []overrides.Override `json:"overrides,omitempty"`
 }
 
 type Artifact struct {
@@ -33,49 +41,141 @@ type Artifact struct {
 	Bytes  int64  `json:"bytes"`
 }
 
+// SourceInfo records exactly which upstream snapshot of an RIR's
+// delegated-extended-latest file produced a build, so the result can be
+// audited later.
+type SourceInfo struct {
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	LastModified string `json:"last_modified,omitempty"`
+	Bytes        int64  `json:"bytes"`
+	Sha256       string `json:"sha256"`
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "apply-delta" {
+		runApplyDelta(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		runVerify(os.Args[2:])
+		return
+	}
+
 	out := flag.String("out", "dist", "output directory")
 	version := flag.String("version", time.Now().UTC().Format("2006-01-02"), "version")
+	prev := flag.String("prev", "", "previous release version (read from -prev-source) to diff against and publish a delta for")
+	prevSource := flag.String("prev-source", "", "directory or base URL to fetch the -prev release from (defaults to -out, e.g. when it was staged by a prior build step)")
+	signingKey := flag.String("signing-key", "", "path to a hex-encoded Ed25519 private key used to sign the manifest")
+	keyID := flag.String("key-id", "", "identifier for the signing key, embedded in the manifest's signature")
+	overridesPath := flag.String("overrides", "", "path to a JSON or YAML file of country overrides applied after the RIR merge")
 	flag.Parse()
 
-	recs, sources := build()
+	recs, asnRecs, sources := build()
+
+	var appliedOverrides []overrides.Override
+	if *overridesPath != "" {
+		ovs, err := overrides.Load(*overridesPath)
+		must(err)
+		recs, appliedOverrides, err = overrides.Apply(recs, ovs, time.Now().UTC())
+		must(err)
+	}
+
 	sort.Slice(recs, func(i, j int) bool { return recs[i].Prefix < recs[j].Prefix })
+	sort.Slice(asnRecs, func(i, j int) bool { return asnRecs[i].ASN < asnRecs[j].ASN })
 
 	releaseDir := filepath.Join(*out, "releases", *version)
 	must(os.MkdirAll(releaseDir, 0o755))
 
 	gz := filepath.Join(releaseDir, "countrydb.csv.gz")
-	bytes, sha := writeCSVGZ(gz, recs)
+	gzBytes, gzSha := writeCSVGZ(gz, recs)
+
+	must(os.WriteFile(gz+".sha256", []byte(fmt.Sprintf("%s  countrydb.csv.gz\n", gzSha)), 0o644))
+
+	mmdbPath := filepath.Join(releaseDir, "countrydb.mmdb")
+	mmdbBytes, mmdbSha := writeMMDB(mmdbPath, recs)
 
-	must(os.WriteFile(gz+".sha256", []byte(fmt.Sprintf("%s  countrydb.csv.gz\n", sha)), 0o644))
+	must(os.WriteFile(mmdbPath+".sha256", []byte(fmt.Sprintf("%s  countrydb.mmdb\n", mmdbSha)), 0o644))
+
+	asnGz := filepath.Join(releaseDir, "asndb.csv.gz")
+	asnBytes, asnSha := writeASNCSVGZ(asnGz, asnRecs)
+
+	must(os.WriteFile(asnGz+".sha256", []byte(fmt.Sprintf("%s  asndb.csv.gz\n", asnSha)), 0o644))
 
 	latest := Latest{
 		Name:        "deflect-geoip-country",
 		Version:     *version,
 		GeneratedAt: time.Now().UTC(),
 		Sources:     sources,
-		Artifacts: []Artifact{{
-			Type:   "countrydb.csv.gz",
-			Path:   fmt.Sprintf("releases/%s/countrydb.csv.gz", *version),
-			Sha256: sha,
-			Bytes:  bytes,
-		}},
+		Overrides:   appliedOverrides,
+		Artifacts: []Artifact{
+			{
+				Type:   "countrydb.csv.gz",
+				Path:   fmt.Sprintf("releases/%s/countrydb.csv.gz", *version),
+				Sha256: gzSha,
+				Bytes:  gzBytes,
+			},
+			{
+				Type:   "countrydb.mmdb",
+				Path:   fmt.Sprintf("releases/%s/countrydb.mmdb", *version),
+				Sha256: mmdbSha,
+				Bytes:  mmdbBytes,
+			},
+			{
+				Type:   "asndb.csv.gz",
+				Path:   fmt.Sprintf("releases/%s/asndb.csv.gz", *version),
+				Sha256: asnSha,
+				Bytes:  asnBytes,
+			},
+		},
+	}
+
+	if *prev != "" {
+		source := *prevSource
+		if source == "" {
+			source = *out
+		}
+		latest.Deltas = []Delta{buildDelta(*out, source, *prev, *version, recs)}
+	}
+
+	if *signingKey != "" {
+		sig := signLatest(*signingKey, *keyID, latest)
+		latest.Signature = &sig
 	}
 
 	must(os.MkdirAll(filepath.Join(*out, "releases"), 0o755))
 	writeJSON(filepath.Join(*out, "releases", "latest.json"), latest)
 }
 
-func build() ([]rir.Record, []string) {
+// signLatest signs the canonical JSON encoding of latest (with its
+// Signature field left unset, since the signature cannot cover itself)
+// using the Ed25519 private key stored hex-encoded at keyPath.
+func signLatest(keyPath, keyID string, latest Latest) sign.Signature {
+	hexKey, err := os.ReadFile(keyPath)
+	must(err)
+	raw, err := hex.DecodeString(strings.TrimSpace(string(hexKey)))
+	must(err)
+	if len(raw) != ed25519.PrivateKeySize {
+		panic(fmt.Sprintf("signing key at %s is %d bytes, want %d", keyPath, len(raw), ed25519.PrivateKeySize))
+	}
+
+	payload, err := sign.Canonical(latest)
+	must(err)
+	return sign.Sign(ed25519.PrivateKey(raw), keyID, payload)
+}
+
+func build() ([]rir.Record, []rir.ASNRecord, []SourceInfo) {
 	client := &http.Client{Timeout: 5 * time.Minute}
 	var all []rir.Record
-	var src []string
+	var allASN []rir.ASNRecord
+	var src []SourceInfo
 
 	for name, url := range rir.Sources {
 		fmt.Printf("Fetching %s...\n", name)
-		recs := fetchWithRetry(client, name, url)
+		recs, asnRecs, info := fetchWithRetry(client, name, url)
 		all = append(all, recs...)
-		src = append(src, name+"-delegated")
+		allASN = append(allASN, asnRecs...)
+		src = append(src, info)
 	}
 
 	seen := map[string]string{}
@@ -89,8 +189,21 @@ func build() ([]rir.Record, []string) {
 			out = append(out, r)
 		}
 	}
-	sort.Strings(src)
-	return out, src
+
+	seenASN := map[uint32]string{}
+	var outASN []rir.ASNRecord
+	for _, r := range allASN {
+		if prev, ok := seenASN[r.ASN]; ok && prev != r.Country {
+			panic(fmt.Sprintf("country conflict for ASN %d", r.ASN))
+		}
+		if _, ok := seenASN[r.ASN]; !ok {
+			seenASN[r.ASN] = r.Country
+			outASN = append(outASN, r)
+		}
+	}
+
+	sort.Slice(src, func(i, j int) bool { return src[i].Name < src[j].Name })
+	return out, outASN, src
 }
 
 func writeCSVGZ(path string, records []rir.Record) (int64, string) {
@@ -113,6 +226,40 @@ func writeCSVGZ(path string, records []rir.Record) (int64, string) {
 	return st.Size(), hex.EncodeToString(h.Sum(nil))
 }
 
+func writeASNCSVGZ(path string, records []rir.ASNRecord) (int64, string) {
+	f, err := os.Create(path)
+	must(err)
+	defer f.Close()
+
+	h := sha256.New()
+	mw := io.MultiWriter(f, h)
+	gw := gzip.NewWriter(mw)
+
+	_, _ = gw.Write([]byte("asn_start,asn_count,country\n"))
+	for _, r := range records {
+		_, _ = fmt.Fprintf(gw, "%d,%d,%s\n", r.ASN, r.Count, r.Country)
+	}
+	must(gw.Close())
+
+	st, err := os.Stat(path)
+	must(err)
+	return st.Size(), hex.EncodeToString(h.Sum(nil))
+}
+
+func writeMMDB(path string, records []rir.Record) (int64, string) {
+	f, err := os.Create(path)
+	must(err)
+	defer f.Close()
+
+	h := sha256.New()
+	mw := io.MultiWriter(f, h)
+	must(mmdb.Write(mw, records))
+
+	st, err := os.Stat(path)
+	must(err)
+	return st.Size(), hex.EncodeToString(h.Sum(nil))
+}
+
 func writeJSON(path string, v any) {
 	b, err := json.MarshalIndent(v, "", "  ")
 	must(err)
@@ -125,7 +272,7 @@ func must(err error) {
 	}
 }
 
-func fetchWithRetry(client *http.Client, name, url string) []rir.Record {
+func fetchWithRetry(client *http.Client, name, url string) ([]rir.Record, []rir.ASNRecord, SourceInfo) {
 	const maxRetries = 5
 	var lastErr error
 
@@ -143,6 +290,7 @@ func fetchWithRetry(client *http.Client, name, url string) []rir.Record {
 			time.Sleep(time.Duration(attempt*10) * time.Second)
 			continue
 		}
+		lastModified := resp.Header.Get("Last-Modified")
 
 		// Download entire body first to avoid connection reset during streaming parse
 		body, err := io.ReadAll(resp.Body)
@@ -155,15 +303,24 @@ func fetchWithRetry(client *http.Client, name, url string) []rir.Record {
 		}
 		fmt.Printf("  Downloaded %d bytes\n", len(body))
 
-		recs, err := rir.ParseDelegatedExtended(bytes.NewReader(body))
+		recs, asnRecs, err := rir.ParseDelegatedExtended(bytes.NewReader(body))
 		if err != nil {
 			lastErr = err
 			fmt.Printf("  Attempt %d parse failed: %v\n", attempt, err)
 			continue
 		}
 
-		fmt.Printf("  Got %d records\n", len(recs))
-		return recs
+		sum := sha256.Sum256(body)
+		info := SourceInfo{
+			Name:         name + "-delegated",
+			URL:          url,
+			LastModified: lastModified,
+			Bytes:        int64(len(body)),
+			Sha256:       hex.EncodeToString(sum[:]),
+		}
+
+		fmt.Printf("  Got %d records, %d ASN records\n", len(recs), len(asnRecs))
+		return recs, asnRecs, info
 	}
 
 	panic(fmt.Sprintf("failed to fetch %s after %d attempts: %v", name, maxRetries, lastErr))
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/equalitie/deflect-geoip/internal/rir"
+)
+
+func TestWriteASNCSVGZ(t *testing.T) {
+	records := []rir.ASNRecord{
+		{ASN: 64512, Count: 4, Country: "DE"},
+		{ASN: 65000, Count: 1, Country: "US"},
+	}
+
+	path := filepath.Join(t.TempDir(), "asndb.csv.gz")
+	size, sha := writeASNCSVGZ(path, records)
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(len(raw)) != size {
+		t.Errorf("writeASNCSVGZ size = %d, want %d (len of written file)", size, len(raw))
+	}
+	sum := sha256.Sum256(raw)
+	if got := hex.EncodeToString(sum[:]); got != sha {
+		t.Errorf("writeASNCSVGZ sha256 = %s, want %s", sha, got)
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gr.Close()
+
+	var lines []string
+	sc := bufio.NewScanner(gr)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"asn_start,asn_count,country",
+		"64512,4,DE",
+		"65000,1,US",
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("writeASNCSVGZ body = %v, want %v", lines, want)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/equalitie/deflect-geoip/internal/sign"
+)
+
+// runVerify implements the "verify" subcommand: download a manifest,
+// check its signature against a pinned public key, and validate every
+// artifact's sha256.
+func runVerify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	source := fs.String("source", "dist", "directory or base URL serving releases/latest.json")
+	pubKeyPath := fs.String("pubkey", "", "path to the hex-encoded Ed25519 public key pinned for verification")
+	must(fs.Parse(args))
+
+	if *pubKeyPath == "" {
+		fmt.Fprintln(os.Stderr, "verify: -pubkey is required")
+		os.Exit(2)
+	}
+
+	manifestRaw := fetchRelease(*source, "releases/latest.json")
+	var latest Latest
+	must(json.Unmarshal(manifestRaw, &latest))
+
+	if latest.Signature == nil {
+		panic("verify: manifest has no signature")
+	}
+	sig := *latest.Signature
+
+	unsigned := latest
+	unsigned.Signature = nil
+	payload, err := sign.Canonical(unsigned)
+	must(err)
+
+	hexKey, err := os.ReadFile(*pubKeyPath)
+	must(err)
+	rawKey, err := hex.DecodeString(strings.TrimSpace(string(hexKey)))
+	must(err)
+	if len(rawKey) != ed25519.PublicKeySize {
+		panic(fmt.Sprintf("public key at %s is %d bytes, want %d", *pubKeyPath, len(rawKey), ed25519.PublicKeySize))
+	}
+
+	must(sign.Verify(ed25519.PublicKey(rawKey), payload, sig))
+	fmt.Printf("signature OK (key %s)\n", sig.KeyID)
+
+	for _, a := range latest.Artifacts {
+		raw := fetchRelease(*source, a.Path)
+		sum := sha256.Sum256(raw)
+		if got := hex.EncodeToString(sum[:]); got != a.Sha256 {
+			panic(fmt.Sprintf("sha256 mismatch for %s: got %s want %s", a.Path, got, a.Sha256))
+		}
+		fmt.Printf("  %s: OK (%d bytes)\n", a.Type, len(raw))
+	}
+
+	fmt.Printf("release %s verified\n", latest.Version)
+}
+
+// fetchRelease reads rel (a path relative to the release layout root)
+// either from the local filesystem or over HTTP(S), depending on
+// source. Shared by the "verify" subcommand and buildDelta's --prev
+// handling, which both need to pull a release artifact from either a
+// local output directory or a published base URL.
+func fetchRelease(source, rel string) []byte {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		u, err := url.JoinPath(source, rel)
+		must(err)
+		resp, err := http.Get(u)
+		must(err)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			panic(fmt.Sprintf("GET %s: status %d", u, resp.StatusCode))
+		}
+		body, err := io.ReadAll(resp.Body)
+		must(err)
+		return body
+	}
+
+	raw, err := os.ReadFile(filepath.Join(source, filepath.FromSlash(rel)))
+	must(err)
+	return raw
+}
@@ -0,0 +1,298 @@
+// Command geoip-server serves IP-to-country lookups over HTTP from a
+// deflect-geoip release, without requiring any third-party GeoIP
+// library. It loads the published countrydb.csv.gz into an in-memory
+// longest-prefix-match trie and polls releases/latest.json so new
+// releases are picked up without a restart.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/equalitie/deflect-geoip/internal/trie"
+)
+
+// manifest mirrors the fields of cmd/build-countrydb's Latest that the
+// server cares about; it intentionally only decodes what it needs.
+type manifest struct {
+	Version   string             `json:"version"`
+	Artifacts []manifestArtifact `json:"artifacts"`
+}
+
+type manifestArtifact struct {
+	Type   string `json:"type"`
+	Path   string `json:"path"`
+	Sha256 string `json:"sha256"`
+}
+
+// db is an immutable snapshot of a loaded release. Reloads build a new
+// db and atomically swap the pointer held by server.
+type db struct {
+	t        *trie.Trie
+	version  string
+	loadedAt time.Time
+}
+
+type server struct {
+	source  string // directory or base URL containing releases/latest.json
+	current atomic.Pointer[db]
+
+	lookups    atomic.Int64
+	hits       atomic.Int64
+	misses     atomic.Int64
+	reloadOK   atomic.Int64
+	reloadFail atomic.Int64
+	lastReload atomic.Int64 // unix seconds
+}
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to listen on")
+	source := flag.String("source", "dist", "directory or base URL serving releases/latest.json")
+	poll := flag.Duration("poll", 5*time.Minute, "how often to check for a new release")
+	flag.Parse()
+
+	s := &server{source: *source}
+
+	if err := s.reload(); err != nil {
+		log.Fatalf("initial load failed: %v", err)
+	}
+
+	go s.pollLoop(*poll)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/lookup/", s.handleLookup)
+	mux.HandleFunc("/v1/bulk", s.handleBulk)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+
+	log.Printf("listening on %s (source=%s)", *listen, *source)
+	log.Fatal(http.ListenAndServe(*listen, mux))
+}
+
+func (s *server) pollLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := s.reload(); err != nil {
+			log.Printf("reload failed: %v", err)
+		}
+	}
+}
+
+// reload fetches releases/latest.json, and if it names a version other
+// than the one currently loaded, downloads and verifies countrydb.csv.gz
+// and swaps it in.
+func (s *server) reload() error {
+	m, err := s.fetchManifest()
+	if err != nil {
+		s.reloadFail.Add(1)
+		return err
+	}
+
+	if cur := s.current.Load(); cur != nil && cur.version == m.Version {
+		return nil
+	}
+
+	var art *manifestArtifact
+	for i := range m.Artifacts {
+		if m.Artifacts[i].Type == "countrydb.csv.gz" {
+			art = &m.Artifacts[i]
+			break
+		}
+	}
+	if art == nil {
+		s.reloadFail.Add(1)
+		return fmt.Errorf("manifest for version %s has no countrydb.csv.gz artifact", m.Version)
+	}
+
+	raw, err := s.fetch(art.Path)
+	if err != nil {
+		s.reloadFail.Add(1)
+		return fmt.Errorf("fetching %s: %w", art.Path, err)
+	}
+
+	sum := sha256.Sum256(raw)
+	if got := hex.EncodeToString(sum[:]); got != art.Sha256 {
+		s.reloadFail.Add(1)
+		return fmt.Errorf("sha256 mismatch for %s: got %s want %s", art.Path, got, art.Sha256)
+	}
+
+	t, err := loadCSVGZ(raw)
+	if err != nil {
+		s.reloadFail.Add(1)
+		return fmt.Errorf("parsing %s: %w", art.Path, err)
+	}
+
+	s.current.Store(&db{t: t, version: m.Version, loadedAt: time.Now()})
+	s.reloadOK.Add(1)
+	s.lastReload.Store(time.Now().Unix())
+	log.Printf("loaded release %s (%d prefixes)", m.Version, t.Len())
+	return nil
+}
+
+func (s *server) fetchManifest() (manifest, error) {
+	raw, err := s.fetch("releases/latest.json")
+	if err != nil {
+		return manifest{}, err
+	}
+	var m manifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return manifest{}, fmt.Errorf("decoding manifest: %w", err)
+	}
+	return m, nil
+}
+
+// fetch reads rel (a path relative to the release layout root) either
+// from the local filesystem or over HTTP(S), depending on s.source.
+func (s *server) fetch(rel string) ([]byte, error) {
+	if strings.HasPrefix(s.source, "http://") || strings.HasPrefix(s.source, "https://") {
+		u, err := url.JoinPath(s.source, rel)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.Get(u)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("GET %s: status %d", u, resp.StatusCode)
+		}
+		return io.ReadAll(resp.Body)
+	}
+	return os.ReadFile(filepath.Join(s.source, filepath.FromSlash(rel)))
+}
+
+func loadCSVGZ(raw []byte) (*trie.Trie, error) {
+	gr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	t := trie.New()
+	sc := bufio.NewScanner(gr)
+	first := true
+	for sc.Scan() {
+		line := sc.Text()
+		if first {
+			first = false
+			continue // header: prefix,country
+		}
+		parts := strings.SplitN(line, ",", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if err := t.Insert(parts[0], parts[1]); err != nil {
+			return nil, err
+		}
+	}
+	return t, sc.Err()
+}
+
+func (s *server) handleLookup(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimPrefix(r.URL.Path, "/v1/lookup/")
+	ip = path.Clean("/" + ip)[1:]
+	if ip == "" {
+		http.Error(w, "missing ip", http.StatusBadRequest)
+		return
+	}
+
+	s.lookups.Add(1)
+	cur := s.current.Load()
+	country, prefix, ok := cur.t.Lookup(ip)
+	if !ok {
+		s.misses.Add(1)
+		http.Error(w, "no match", http.StatusNotFound)
+		return
+	}
+	s.hits.Add(1)
+
+	writeJSON(w, map[string]string{
+		"ip":      ip,
+		"country": country,
+		"prefix":  prefix,
+	})
+}
+
+func (s *server) handleBulk(w http.ResponseWriter, r *http.Request) {
+	var ips []string
+	if err := json.NewDecoder(r.Body).Decode(&ips); err != nil {
+		http.Error(w, "invalid JSON body: expected an array of IPs", http.StatusBadRequest)
+		return
+	}
+
+	cur := s.current.Load()
+	out := make([]map[string]string, 0, len(ips))
+	for _, ip := range ips {
+		s.lookups.Add(1)
+		country, prefix, ok := cur.t.Lookup(ip)
+		if !ok {
+			s.misses.Add(1)
+			out = append(out, map[string]string{"ip": ip})
+			continue
+		}
+		s.hits.Add(1)
+		out = append(out, map[string]string{"ip": ip, "country": country, "prefix": prefix})
+	}
+	writeJSON(w, out)
+}
+
+func (s *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	cur := s.current.Load()
+	writeJSON(w, map[string]any{
+		"status":    "ok",
+		"version":   cur.version,
+		"loaded_at": cur.loadedAt.UTC().Format(time.RFC3339),
+		"prefixes":  cur.t.Len(),
+	})
+}
+
+func (s *server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintf(w, "# HELP geoip_lookups_total Total number of lookups served.\n")
+	fmt.Fprintf(w, "# TYPE geoip_lookups_total counter\n")
+	fmt.Fprintf(w, "geoip_lookups_total %d\n", s.lookups.Load())
+
+	fmt.Fprintf(w, "# HELP geoip_lookup_hits_total Lookups that matched a prefix.\n")
+	fmt.Fprintf(w, "# TYPE geoip_lookup_hits_total counter\n")
+	fmt.Fprintf(w, "geoip_lookup_hits_total %d\n", s.hits.Load())
+
+	fmt.Fprintf(w, "# HELP geoip_lookup_misses_total Lookups with no matching prefix.\n")
+	fmt.Fprintf(w, "# TYPE geoip_lookup_misses_total counter\n")
+	fmt.Fprintf(w, "geoip_lookup_misses_total %d\n", s.misses.Load())
+
+	fmt.Fprintf(w, "# HELP geoip_reload_total Release reload attempts by outcome.\n")
+	fmt.Fprintf(w, "# TYPE geoip_reload_total counter\n")
+	fmt.Fprintf(w, "geoip_reload_total{outcome=\"success\"} %d\n", s.reloadOK.Load())
+	fmt.Fprintf(w, "geoip_reload_total{outcome=\"failure\"} %d\n", s.reloadFail.Load())
+
+	fmt.Fprintf(w, "# HELP geoip_last_reload_timestamp_seconds Unix time of the last successful reload.\n")
+	fmt.Fprintf(w, "# TYPE geoip_last_reload_timestamp_seconds gauge\n")
+	fmt.Fprintf(w, "geoip_last_reload_timestamp_seconds %d\n", s.lastReload.Load())
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(b)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReloadRejectsSha256Mismatch(t *testing.T) {
+	dir := t.TempDir()
+	gzPath := filepath.Join(dir, "releases", "2024-01-01", "countrydb.csv.gz")
+	mustWriteGzipCSV(t, gzPath, "prefix,country\n1.2.3.0/24,US\n")
+
+	writeManifest(t, dir, manifest{
+		Version: "2024-01-01",
+		Artifacts: []manifestArtifact{
+			{
+				Type:   "countrydb.csv.gz",
+				Path:   "releases/2024-01-01/countrydb.csv.gz",
+				Sha256: strings.Repeat("0", 64), // deliberately wrong
+			},
+		},
+	})
+
+	s := &server{source: dir}
+	err := s.reload()
+	if err == nil {
+		t.Fatal("reload() with a mismatched sha256 = nil error, want error")
+	}
+	if !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Errorf("reload() error = %v, want a sha256 mismatch error", err)
+	}
+	if got := s.reloadFail.Load(); got != 1 {
+		t.Errorf("reloadFail = %d, want 1", got)
+	}
+	if s.current.Load() != nil {
+		t.Error("current db was set despite a failed reload")
+	}
+}
+
+func TestReloadSucceedsWithMatchingSha256(t *testing.T) {
+	dir := t.TempDir()
+	gzPath := filepath.Join(dir, "releases", "2024-01-01", "countrydb.csv.gz")
+	sum := mustWriteGzipCSV(t, gzPath, "prefix,country\n1.2.3.0/24,US\n")
+
+	writeManifest(t, dir, manifest{
+		Version: "2024-01-01",
+		Artifacts: []manifestArtifact{
+			{Type: "countrydb.csv.gz", Path: "releases/2024-01-01/countrydb.csv.gz", Sha256: sum},
+		},
+	})
+
+	s := &server{source: dir}
+	if err := s.reload(); err != nil {
+		t.Fatalf("reload() returned error: %v", err)
+	}
+	if got := s.reloadOK.Load(); got != 1 {
+		t.Errorf("reloadOK = %d, want 1", got)
+	}
+
+	cur := s.current.Load()
+	if cur == nil || cur.version != "2024-01-01" {
+		t.Fatalf("current = %+v, want version 2024-01-01 loaded", cur)
+	}
+	country, prefix, ok := cur.t.Lookup("1.2.3.5")
+	if !ok || country != "US" || prefix != "1.2.3.0/24" {
+		t.Errorf("Lookup(1.2.3.5) = (%q, %q, %v), want (US, 1.2.3.0/24, true)", country, prefix, ok)
+	}
+}
+
+// mustWriteGzipCSV gzips csv to path, creating any missing parent
+// directories, and returns the hex sha256 of the gzipped bytes.
+func mustWriteGzipCSV(t *testing.T, path, csv string) string {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	gw := gzip.NewWriter(io.MultiWriter(f, h))
+	if _, err := gw.Write([]byte(csv)); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeManifest(t *testing.T, dir string, m manifest) {
+	t.Helper()
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	releasesDir := filepath.Join(dir, "releases")
+	if err := os.MkdirAll(releasesDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(releasesDir, "latest.json"), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
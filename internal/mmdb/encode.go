@@ -0,0 +1,119 @@
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// MaxMind DB data section type numbers (see the MaxMind DB file format
+// specification).
+const (
+	typePointer = 1
+	typeString  = 2
+	typeUint16  = 5
+	typeUint32  = 6
+	typeMap     = 7
+	typeUint64  = 9
+	typeArray   = 11
+)
+
+// dataWriter builds the MaxMind DB "data section": a sequence of
+// self-describing, type-tagged values referenced by byte offset from
+// the node array's record pointers.
+type dataWriter struct {
+	buf bytes.Buffer
+}
+
+// offset returns the current write position, i.e. the offset a pointer
+// to the next written value should use.
+func (d *dataWriter) offset() int {
+	return d.buf.Len()
+}
+
+func (d *dataWriter) writeControl(typ int, size int) {
+	if typ <= 7 {
+		b := byte(typ) << 5
+		d.writeSize(b, size)
+		return
+	}
+	// Extended type: top 3 bits of the control byte are 0, the type is
+	// carried in the following byte as (typ - 7), ahead of any size
+	// extension bytes.
+	var tmp dataWriter
+	tmp.writeSize(0, size)
+	sized := tmp.buf.Bytes()
+	d.buf.WriteByte(sized[0])
+	d.buf.WriteByte(byte(typ - 7))
+	d.buf.Write(sized[1:])
+}
+
+func (d *dataWriter) writeSize(ctrl byte, size int) {
+	switch {
+	case size < 29:
+		d.buf.WriteByte(ctrl | byte(size))
+	case size < 285:
+		d.buf.WriteByte(ctrl | 29)
+		d.buf.WriteByte(byte(size - 29))
+	case size < 65821:
+		d.buf.WriteByte(ctrl | 30)
+		n := size - 285
+		d.buf.WriteByte(byte(n >> 8))
+		d.buf.WriteByte(byte(n))
+	default:
+		d.buf.WriteByte(ctrl | 31)
+		n := size - 65821
+		d.buf.WriteByte(byte(n >> 16))
+		d.buf.WriteByte(byte(n >> 8))
+		d.buf.WriteByte(byte(n))
+	}
+}
+
+func (d *dataWriter) writeString(s string) {
+	d.writeControl(typeString, len(s))
+	d.buf.WriteString(s)
+}
+
+func (d *dataWriter) writeUint32(v uint32) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	d.writeControl(typeUint32, len(b))
+	d.buf.Write(b)
+}
+
+func (d *dataWriter) writeUint16(v uint16) {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	d.writeControl(typeUint16, len(b))
+	d.buf.Write(b)
+}
+
+func (d *dataWriter) writeUint64(v uint64) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	d.writeControl(typeUint64, len(b))
+	d.buf.Write(b)
+}
+
+// writeMap writes a map value. Keys are sorted so the encoding is
+// deterministic across runs.
+func (d *dataWriter) writeMap(m map[string]func()) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	d.writeControl(typeMap, len(keys))
+	for _, k := range keys {
+		d.writeString(k)
+		m[k]()
+	}
+}
+
+func (d *dataWriter) writeArray(n int, each func(i int)) {
+	d.writeControl(typeArray, n)
+	for i := 0; i < n; i++ {
+		each(i)
+	}
+}
@@ -0,0 +1,222 @@
+// Package mmdb writes MaxMind DB (.mmdb) files, the binary format used
+// by libmaxminddb and its language bindings, so deflect-geoip's country
+// data can be dropped into any existing MaxMind-compatible reader.
+//
+// Only what deflect-geoip needs is implemented: a record size of 24
+// bits, an IPv4-mapped-in-IPv6 tree, and a data section holding a single
+// {"country": {"iso_code": ...}} map per distinct country.
+package mmdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/equalitie/deflect-geoip/internal/rir"
+)
+
+const (
+	recordSize  = 24 // bits per record; two records per node
+	nodeBytes   = recordSize * 2 / 8
+	marker      = "\xab\xcd\xefMaxMind.com"
+	description = "deflect-geoip country database"
+)
+
+// node is a branch point in the 128-bit binary search tree. A node with
+// no children is never materialized; leaves are represented by a data
+// pointer or the "no data" record instead.
+type node struct {
+	children [2]*node
+	assigned bool
+	country  string
+}
+
+// Write encodes records as a MaxMind DB file and writes it to w.
+func Write(w io.Writer, records []rir.Record) error {
+	root := &node{}
+	for _, r := range records {
+		if err := insert(root, r.Prefix, r.Country); err != nil {
+			return err
+		}
+	}
+
+	order := allocate(root)
+	nodeCount := len(order)
+
+	data, offsets, err := buildDataSection(order)
+	if err != nil {
+		return err
+	}
+
+	if err := writeNodes(w, order, nodeCount, offsets); err != nil {
+		return err
+	}
+
+	// 16 zero bytes separate the tree from the data section, per spec.
+	if _, err := w.Write(make([]byte, 16)); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	return writeMetadata(w, nodeCount)
+}
+
+// insert adds a CIDR prefix to the tree, expanding IPv4 prefixes into
+// the low 32 bits of the 128-bit IPv4-mapped space (i.e. ::a.b.c.d),
+// which is how MaxMind DB embeds IPv4 networks in an IPv6-shaped tree.
+func insert(root *node, prefix, country string) error {
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return fmt.Errorf("mmdb: invalid prefix %q: %w", prefix, err)
+	}
+
+	ones, _ := ipnet.Mask.Size()
+	var ip [16]byte
+	if v4 := ipnet.IP.To4(); v4 != nil {
+		copy(ip[12:], v4)
+		ones += 96
+	} else {
+		copy(ip[:], ipnet.IP.To16())
+	}
+
+	cur := root
+	for i := 0; i < ones; i++ {
+		bit := (ip[i/8] >> uint(7-i%8)) & 1
+		if cur.children[bit] == nil {
+			cur.children[bit] = &node{}
+		}
+		cur = cur.children[bit]
+	}
+	cur.assigned = true
+	cur.country = country
+	return nil
+}
+
+func isBranch(n *node) bool {
+	return n.children[0] != nil || n.children[1] != nil
+}
+
+// allocate assigns each branch node an index in the flattened node
+// array via pre-order traversal starting at the root, which always
+// occupies index 0.
+func allocate(root *node) []*node {
+	var order []*node
+	var visit func(n *node)
+	visit = func(n *node) {
+		order = append(order, n)
+		for _, c := range n.children {
+			if c != nil && isBranch(c) {
+				visit(c)
+			}
+		}
+	}
+	visit(root)
+	return order
+}
+
+// buildDataSection writes one map value per distinct country found in
+// order, and returns the byte offset of each country's value so node
+// records can point at it. Leaves that share a country therefore share
+// a single data section entry.
+func buildDataSection(order []*node) ([]byte, map[string]int, error) {
+	d := &dataWriter{}
+	offsets := map[string]int{}
+
+	record := func(n *node) {
+		if n == nil || !n.assigned || isBranch(n) {
+			return
+		}
+		if _, ok := offsets[n.country]; ok {
+			return
+		}
+		offsets[n.country] = d.offset()
+		country := n.country
+		d.writeMap(map[string]func(){
+			"country": func() {
+				d.writeMap(map[string]func(){
+					"iso_code": func() { d.writeString(country) },
+				})
+			},
+		})
+	}
+
+	for _, n := range order {
+		for _, c := range n.children {
+			record(c)
+		}
+	}
+	if !isBranch(order[0]) {
+		record(order[0])
+	}
+
+	return d.buf.Bytes(), offsets, nil
+}
+
+func writeNodes(w io.Writer, order []*node, nodeCount int, offsets map[string]int) error {
+	indexOf := make(map[*node]int, len(order))
+	for i, n := range order {
+		indexOf[n] = i
+	}
+
+	recordValue := func(n *node) uint32 {
+		switch {
+		case n == nil:
+			return uint32(nodeCount)
+		case isBranch(n):
+			return uint32(indexOf[n])
+		case n.assigned:
+			return uint32(nodeCount + 16 + offsets[n.country])
+		default:
+			return uint32(nodeCount)
+		}
+	}
+
+	buf := make([]byte, nodeBytes)
+	for _, n := range order {
+		r0 := recordValue(n.children[0])
+		r1 := recordValue(n.children[1])
+		put24(buf[0:3], r0)
+		put24(buf[3:6], r1)
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func put24(b []byte, v uint32) {
+	var tmp [4]byte
+	binary.BigEndian.PutUint32(tmp[:], v)
+	copy(b, tmp[1:])
+}
+
+func writeMetadata(w io.Writer, nodeCount int) error {
+	d := &dataWriter{}
+	d.writeMap(map[string]func(){
+		"node_count":    func() { d.writeUint32(uint32(nodeCount)) },
+		"record_size":   func() { d.writeUint16(recordSize) },
+		"ip_version":    func() { d.writeUint16(6) },
+		"database_type": func() { d.writeString("deflect-geoip-country") },
+		"languages": func() {
+			d.writeArray(1, func(i int) { d.writeString("en") })
+		},
+		"description": func() {
+			d.writeMap(map[string]func(){
+				"en": func() { d.writeString(description) },
+			})
+		},
+		"binary_format_major_version": func() { d.writeUint16(2) },
+		"binary_format_minor_version": func() { d.writeUint16(0) },
+		"build_epoch":                 func() { d.writeUint64(uint64(time.Now().Unix())) },
+	})
+
+	if _, err := w.Write([]byte(marker)); err != nil {
+		return err
+	}
+	_, err := w.Write(d.buf.Bytes())
+	return err
+}
@@ -0,0 +1,71 @@
+package mmdb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/equalitie/deflect-geoip/internal/rir"
+)
+
+func TestWriteRejectsInvalidPrefix(t *testing.T) {
+	records := []rir.Record{{Prefix: "not-a-cidr", Country: "US"}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, records); err == nil {
+		t.Fatal("Write() with an invalid prefix = nil error, want error")
+	}
+}
+
+func TestWriteProducesWellFormedFile(t *testing.T) {
+	records := []rir.Record{
+		{Prefix: "1.2.3.0/24", Country: "US"},
+		{Prefix: "1.2.4.0/24", Country: "CA"},
+		{Prefix: "2001:db8::/32", Country: "DE"},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, records); err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+
+	out := buf.Bytes()
+	if i := bytes.Index(out, []byte(marker)); i < 0 {
+		t.Fatal("output does not contain the MaxMind metadata marker")
+	}
+
+	// The tree/data split is marked by 16 zero bytes; the node section
+	// preceding it must be a whole number of 6-byte (2x24-bit) records.
+	sep := bytes.Index(out, make([]byte, 16))
+	if sep < 0 {
+		t.Fatal("output does not contain the 16-byte tree/data separator")
+	}
+	if sep%nodeBytes != 0 {
+		t.Fatalf("node section length %d is not a multiple of %d bytes", sep, nodeBytes)
+	}
+}
+
+func TestWriteSharesDataSectionEntryForSameCountry(t *testing.T) {
+	// Two disjoint prefixes assigned to the same country should produce
+	// a single data section entry, since buildDataSection dedupes by
+	// country.
+	shared := []rir.Record{
+		{Prefix: "1.2.3.0/24", Country: "US"},
+		{Prefix: "5.6.7.0/24", Country: "US"},
+	}
+	distinct := []rir.Record{
+		{Prefix: "1.2.3.0/24", Country: "US"},
+		{Prefix: "5.6.7.0/24", Country: "CA"},
+	}
+
+	var sharedBuf, distinctBuf bytes.Buffer
+	if err := Write(&sharedBuf, shared); err != nil {
+		t.Fatalf("Write(shared) returned error: %v", err)
+	}
+	if err := Write(&distinctBuf, distinct); err != nil {
+		t.Fatalf("Write(distinct) returned error: %v", err)
+	}
+
+	if sharedBuf.Len() >= distinctBuf.Len() {
+		t.Errorf("sharing a country's data entry did not shrink the file: shared=%d distinct=%d", sharedBuf.Len(), distinctBuf.Len())
+	}
+}
@@ -0,0 +1,190 @@
+// Package overrides applies a manually maintained allowlist of country
+// corrections on top of the merged RIR data, for cases where a registry
+// misclassifies a range (disputed territories, cloud providers with
+// mis-registered allocations, etc.).
+package overrides
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/equalitie/deflect-geoip/internal/rir"
+)
+
+// Override corrects the country for a single prefix. Expires, if set,
+// causes the override to stop being applied once Apply's caller-supplied
+// time passes it, so stale corrections don't outlive their rationale.
+type Override struct {
+	Prefix  string     `json:"prefix" yaml:"prefix"`
+	Country string     `json:"country" yaml:"country"`
+	Reason  string     `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Expires *time.Time `json:"expires,omitempty" yaml:"expires,omitempty"`
+}
+
+// Load reads a JSON or YAML file containing a list of Override entries,
+// choosing the decoder by the file's extension (".yaml"/".yml" for
+// YAML, anything else for JSON).
+func Load(path string) ([]Override, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("overrides: reading %s: %w", path, err)
+	}
+
+	var out []Override
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(raw, &out); err != nil {
+			return nil, fmt.Errorf("overrides: decoding %s: %w", path, err)
+		}
+	default:
+		if err := json.Unmarshal(raw, &out); err != nil {
+			return nil, fmt.Errorf("overrides: decoding %s: %w", path, err)
+		}
+	}
+	return out, nil
+}
+
+// Apply overlays overrides on top of records, splitting any RIR prefix
+// that overlaps an override into the minimal set of CIDRs that preserve
+// its original country outside the overridden range. It returns the
+// resulting record set and the overrides that were actually applied
+// (i.e. not expired as of now). Applying an override for a country code
+// that fails rir.IsCountryCode is an error.
+func Apply(records []rir.Record, overrides []Override, now time.Time) ([]rir.Record, []Override, error) {
+	var applied []Override
+
+	for _, o := range overrides {
+		if o.Expires != nil && o.Expires.Before(now) {
+			continue
+		}
+
+		cc := strings.ToUpper(o.Country)
+		if !rir.IsCountryCode(cc) {
+			return nil, nil, fmt.Errorf("overrides: %q is not a valid country code for prefix %s", o.Country, o.Prefix)
+		}
+
+		var err error
+		records, err = applyOne(records, o.Prefix, cc)
+		if err != nil {
+			return nil, nil, err
+		}
+		applied = append(applied, o)
+	}
+
+	return records, applied, nil
+}
+
+func applyOne(records []rir.Record, prefix, country string) ([]rir.Record, error) {
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("overrides: invalid prefix %q: %w", prefix, err)
+	}
+
+	v4 := ipnet.IP.To4()
+	if v4 == nil {
+		return applyOneIPv6(records, prefix, country)
+	}
+
+	ones, _ := ipnet.Mask.Size()
+	ovStart := rir.IPToUint32(v4)
+	ovEnd := ovStart + (uint32(1)<<(32-ones) - 1)
+
+	out := make([]rir.Record, 0, len(records)+1)
+	for _, r := range records {
+		rStart, rEnd, ok := ipv4Bounds(r.Prefix)
+		if !ok || rEnd < ovStart || rStart > ovEnd {
+			out = append(out, r)
+			continue
+		}
+
+		if rStart < ovStart {
+			out = append(out, rir.IPv4RangeToCIDRs(rStart, ovStart-1, r.Country)...)
+		}
+		if rEnd > ovEnd {
+			out = append(out, rir.IPv4RangeToCIDRs(ovEnd+1, rEnd, r.Country)...)
+		}
+	}
+
+	return append(out, rir.IPv4RangeToCIDRs(ovStart, ovEnd, country)...), nil
+}
+
+func ipv4Bounds(prefix string) (start, end uint32, ok bool) {
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return 0, 0, false
+	}
+	v4 := ipnet.IP.To4()
+	if v4 == nil {
+		return 0, 0, false
+	}
+	ones, _ := ipnet.Mask.Size()
+	start = rir.IPToUint32(v4)
+	end = start + (uint32(1)<<(32-ones) - 1)
+	return start, end, true
+}
+
+// applyOneIPv6 is the IPv6 analog of the IPv4 branch of applyOne: it
+// splits any record overlapping the override prefix into the minimal
+// set of CIDRs that preserve the original country outside the
+// overridden range, using math/big since the 128-bit range doesn't fit
+// in a machine word.
+func applyOneIPv6(records []rir.Record, prefix, country string) ([]rir.Record, error) {
+	ovStart, ovEnd, ok := ipv6Bounds(prefix)
+	if !ok {
+		return nil, fmt.Errorf("overrides: invalid IPv6 prefix %q", prefix)
+	}
+
+	out := make([]rir.Record, 0, len(records)+1)
+	for _, r := range records {
+		rStart, rEnd, ok := ipv6Bounds(r.Prefix)
+		if !ok || rEnd.Cmp(ovStart) < 0 || rStart.Cmp(ovEnd) > 0 {
+			out = append(out, r)
+			continue
+		}
+
+		if rStart.Cmp(ovStart) < 0 {
+			before := new(big.Int).Sub(ovStart, big.NewInt(1))
+			out = append(out, rir.IPv6RangeToCIDRs(rStart, before, r.Country)...)
+		}
+		if rEnd.Cmp(ovEnd) > 0 {
+			after := new(big.Int).Add(ovEnd, big.NewInt(1))
+			out = append(out, rir.IPv6RangeToCIDRs(after, rEnd, r.Country)...)
+		}
+	}
+
+	return append(out, rir.IPv6RangeToCIDRs(ovStart, ovEnd, country)...), nil
+}
+
+// ipv6Bounds returns the inclusive [start, end] address range covered
+// by an IPv6 CIDR prefix, as big.Int so callers can do range arithmetic
+// beyond what a uint64 holds.
+func ipv6Bounds(prefix string) (start, end *big.Int, ok bool) {
+	_, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, nil, false
+	}
+	if ipnet.IP.To4() != nil {
+		return nil, nil, false
+	}
+	v6 := ipnet.IP.To16()
+	if v6 == nil {
+		return nil, nil, false
+	}
+
+	ones, bitsLen := ipnet.Mask.Size()
+	start = new(big.Int).SetBytes(v6)
+
+	hostMask := new(big.Int).Lsh(big.NewInt(1), uint(bitsLen-ones))
+	hostMask.Sub(hostMask, big.NewInt(1))
+	end = new(big.Int).Or(start, hostMask)
+
+	return start, end, true
+}
@@ -0,0 +1,213 @@
+package overrides
+
+import (
+	"bytes"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/equalitie/deflect-geoip/internal/mmdb"
+	"github.com/equalitie/deflect-geoip/internal/rir"
+)
+
+// sortByAddr sorts records by the numeric value of their prefix's
+// starting address rather than its string form: for IPv6 in particular
+// "2001:db8:8000::/33" sorts before "2001:db8::/33" lexically even
+// though its address is numerically larger, so a plain string sort
+// misorders the output.
+func sortByAddr(t *testing.T, records []rir.Record) {
+	t.Helper()
+	sort.Slice(records, func(i, j int) bool {
+		ai := recordStart(t, records[i].Prefix)
+		aj := recordStart(t, records[j].Prefix)
+		return ai.Cmp(aj) < 0
+	})
+}
+
+func recordStart(t *testing.T, prefix string) *big.Int {
+	t.Helper()
+	ip, _, err := net.ParseCIDR(prefix)
+	if err != nil {
+		t.Fatalf("invalid CIDR %q: %v", prefix, err)
+	}
+	if v4 := ip.To4(); v4 != nil {
+		return new(big.Int).SetBytes(v4)
+	}
+	return new(big.Int).SetBytes(ip.To16())
+}
+
+func TestLoadParsesYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.yaml")
+	const data = `- prefix: 1.2.3.0/24
+  country: CA
+  reason: cloud provider misregistration
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	want := []Override{
+		{Prefix: "1.2.3.0/24", Country: "CA", Reason: "cloud provider misregistration"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Load() = %v, want %v", got, want)
+	}
+}
+
+func TestApplySplitsOverlappingPrefix(t *testing.T) {
+	records := []rir.Record{
+		{Prefix: "1.2.3.0/24", Country: "US"},
+	}
+	ovs := []Override{
+		{Prefix: "1.2.3.128/25", Country: "CA"},
+	}
+
+	got, applied, err := Apply(records, ovs, time.Now())
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if len(applied) != 1 {
+		t.Fatalf("len(applied) = %d, want 1", len(applied))
+	}
+
+	sortByAddr(t, got)
+
+	want := []rir.Record{
+		{Prefix: "1.2.3.0/25", Country: "US"},
+		{Prefix: "1.2.3.128/25", Country: "CA"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() = %v, want %v", got, want)
+	}
+}
+
+func TestApplySkipsExpiredOverride(t *testing.T) {
+	records := []rir.Record{
+		{Prefix: "1.2.3.0/24", Country: "US"},
+	}
+	expired := time.Now().Add(-time.Hour)
+	ovs := []Override{
+		// An invalid country code on an expired entry must not fail the
+		// build: it will never actually be applied.
+		{Prefix: "1.2.3.128/25", Country: "NOTACODE", Expires: &expired},
+	}
+
+	got, applied, err := Apply(records, ovs, time.Now())
+	if err != nil {
+		t.Fatalf("Apply returned error for expired override: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("len(applied) = %d, want 0", len(applied))
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("Apply() = %v, want records unchanged: %v", got, records)
+	}
+}
+
+func TestApplyRejectsInvalidCountryCode(t *testing.T) {
+	records := []rir.Record{
+		{Prefix: "1.2.3.0/24", Country: "US"},
+	}
+	ovs := []Override{
+		{Prefix: "1.2.3.128/25", Country: "NOTACODE"},
+	}
+
+	if _, _, err := Apply(records, ovs, time.Now()); err == nil {
+		t.Fatal("Apply() with an invalid country code = nil error, want error")
+	}
+}
+
+func TestApplySplitsOverlappingIPv6Prefix(t *testing.T) {
+	records := []rir.Record{
+		{Prefix: "2001:db8::/32", Country: "DE"},
+	}
+	ovs := []Override{
+		{Prefix: "2001:db8:8000::/33", Country: "GB"},
+	}
+
+	got, applied, err := Apply(records, ovs, time.Now())
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+	if len(applied) != 1 {
+		t.Fatalf("len(applied) = %d, want 1", len(applied))
+	}
+
+	sortByAddr(t, got)
+
+	want := []rir.Record{
+		{Prefix: "2001:db8::/33", Country: "DE"},
+		{Prefix: "2001:db8:8000::/33", Country: "GB"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() = %v, want %v", got, want)
+	}
+}
+
+// TestApplyIPv6NoNestedPrefixes guards against the bug where an IPv6
+// override left the broader RIR prefix and the narrower override
+// nested in the output: fed into mmdb.Write, a node that is both a
+// data leaf and a branch silently loses its assigned country, so
+// addresses under the broader prefix but outside the override would
+// resolve to no country at all.
+func TestApplyIPv6NoNestedPrefixes(t *testing.T) {
+	records := []rir.Record{
+		{Prefix: "2001:db8::/32", Country: "DE"},
+	}
+	ovs := []Override{
+		{Prefix: "2001:db8:1::/48", Country: "GB"},
+	}
+
+	got, _, err := Apply(records, ovs, time.Now())
+	if err != nil {
+		t.Fatalf("Apply returned error: %v", err)
+	}
+
+	for _, a := range got {
+		for _, b := range got {
+			if a.Prefix == b.Prefix {
+				continue
+			}
+			if cidrStrictlyContains(t, b.Prefix, a.Prefix) {
+				t.Fatalf("%s is nested inside %s; Apply must not produce nested prefixes", a.Prefix, b.Prefix)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := mmdb.Write(&buf, got); err != nil {
+		t.Fatalf("mmdb.Write(Apply output) returned error: %v", err)
+	}
+}
+
+// cidrStrictlyContains reports whether outer is a strict superset of
+// inner (i.e. inner's prefix is longer and falls within outer's range).
+func cidrStrictlyContains(t *testing.T, outer, inner string) bool {
+	t.Helper()
+
+	_, outerNet, err := net.ParseCIDR(outer)
+	if err != nil {
+		t.Fatalf("invalid CIDR %q: %v", outer, err)
+	}
+	innerIP, innerNet, err := net.ParseCIDR(inner)
+	if err != nil {
+		t.Fatalf("invalid CIDR %q: %v", inner, err)
+	}
+
+	outerOnes, _ := outerNet.Mask.Size()
+	innerOnes, _ := innerNet.Mask.Size()
+	if outerOnes >= innerOnes {
+		return false
+	}
+	return outerNet.Contains(innerIP)
+}
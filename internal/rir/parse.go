@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"math/big"
+	"math/bits"
 	"net"
 	"strconv"
 	"strings"
@@ -14,11 +16,23 @@ type Record struct {
 	Country string
 }
 
-func ParseDelegatedExtended(r io.Reader) ([]Record, error) {
+// ASNRecord maps a contiguous range of AS numbers, starting at ASN and
+// covering Count numbers, to the country the RIR registered them under.
+type ASNRecord struct {
+	ASN     uint32
+	Count   uint32
+	Country string
+}
+
+// ParseDelegatedExtended parses a delegated-*-extended-latest file into
+// its "ipv4"/"ipv6" rows (as Records) and its "asn" rows (as
+// ASNRecords) in a single pass over r.
+func ParseDelegatedExtended(r io.Reader) ([]Record, []ASNRecord, error) {
 	sc := bufio.NewScanner(r)
 	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
 
-	var out []Record
+	var recs []Record
+	var asnRecs []ASNRecord
 
 	for sc.Scan() {
 		line := sc.Text()
@@ -47,15 +61,33 @@ func ParseDelegatedExtended(r io.Reader) ([]Record, error) {
 
 		switch typ {
 		case "ipv4":
-			out = append(out, ipv4RangeToCIDRs(start, value, cc)...)
+			recs = append(recs, ipv4RangeToCIDRs(start, value, cc)...)
 		case "ipv6":
 			if rec, ok := ipv6ToCIDR(start, value, cc); ok {
-				out = append(out, rec)
+				recs = append(recs, rec)
+			}
+		case "asn":
+			asn, err := strconv.ParseUint(start, 10, 32)
+			if err != nil {
+				continue
+			}
+			count, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || count == 0 {
+				continue
 			}
+			asnRecs = append(asnRecs, ASNRecord{ASN: uint32(asn), Count: uint32(count), Country: cc})
 		}
 	}
 
-	return out, sc.Err()
+	return recs, asnRecs, sc.Err()
+}
+
+// IsCountryCode reports whether cc looks like a two-letter ISO country
+// code. Exported so other packages (e.g. internal/overrides) can
+// validate user-supplied country codes the same way the RIR parser
+// does.
+func IsCountryCode(cc string) bool {
+	return isCountryCode(cc)
 }
 
 func isCountryCode(cc string) bool {
@@ -87,30 +119,96 @@ func ipv4RangeToCIDRs(start, value, cc string) []Record {
 		return nil
 	}
 
-	startU := ipToUint32(ip4)
+	startU := IPToUint32(ip4)
 	endU := startU + uint32(count) - 1
 
+	return IPv4RangeToCIDRs(startU, endU, cc)
+}
+
+// IPv4RangeToCIDRs returns the minimal set of CIDR blocks that exactly
+// cover the inclusive IPv4 address range [startU, endU], each tagged
+// with country cc. Exported so other packages (e.g. internal/overrides)
+// can reuse the alignment logic when splitting an existing prefix
+// around a narrower override.
+//
+// At each step it takes the largest power-of-two block that is both
+// aligned to the current address and fits within what remains of the
+// range, working in uint64 so a full /0 block (the entire address
+// space) doesn't overflow uint32 arithmetic.
+func IPv4RangeToCIDRs(startU, endU uint32, cc string) []Record {
 	var out []Record
-	cur := startU
-
-	for cur <= endU {
-		prefix := 32
-		for prefix > 0 {
-			block := uint32(1) << (32 - prefix)
-			// Must be aligned and must fit inside [cur, endU]
-			if cur%block != 0 || cur+block-1 > endU {
-				prefix--
-				continue
+	cur := uint64(startU)
+	end := uint64(endU)
+
+	for cur <= end {
+		alignBits := 32
+		if cur != 0 {
+			alignBits = bits.TrailingZeros64(cur)
+			if alignBits > 32 {
+				alignBits = 32
 			}
-			break
 		}
+		for alignBits > 0 && (uint64(1)<<uint(alignBits))-1 > end-cur {
+			alignBits--
+		}
+
+		blockSize := uint64(1) << uint(alignBits)
+		out = append(out, Record{
+			Prefix:  fmt.Sprintf("%s/%d", Uint32ToIP(uint32(cur)), 32-alignBits),
+			Country: cc,
+		})
+
+		cur += blockSize
+	}
+
+	return out
+}
+
+// ipv6Bits is the width of an IPv6 address in bits.
+const ipv6Bits = 128
+
+// IPv6RangeToCIDRs returns the minimal set of CIDR blocks that exactly
+// cover the inclusive IPv6 address range [start, end], each tagged with
+// country cc. It's the 128-bit analog of IPv4RangeToCIDRs, using
+// math/big since the range doesn't fit in a machine word; the
+// alignment search is otherwise identical. Exported so
+// internal/overrides can reuse it to split an IPv6 prefix around a
+// narrower override.
+func IPv6RangeToCIDRs(start, end *big.Int, cc string) []Record {
+	var out []Record
+	one := big.NewInt(1)
+	cur := new(big.Int).Set(start)
+
+	for cur.Cmp(end) <= 0 {
+		alignBits := ipv6Bits
+		if cur.Sign() != 0 {
+			alignBits = int(cur.TrailingZeroBits())
+			if alignBits > ipv6Bits {
+				alignBits = ipv6Bits
+			}
+		}
+
+		remaining := new(big.Int).Sub(end, cur)
+		blockMax := new(big.Int)
+		for alignBits > 0 {
+			blockMax.Lsh(one, uint(alignBits))
+			blockMax.Sub(blockMax, one)
+			if blockMax.Cmp(remaining) <= 0 {
+				break
+			}
+			alignBits--
+		}
+
+		blockSize := new(big.Int).Lsh(one, uint(alignBits))
 
+		ipBytes := make([]byte, 16)
+		cur.FillBytes(ipBytes)
 		out = append(out, Record{
-			Prefix:  fmt.Sprintf("%s/%d", uint32ToIP(cur), prefix),
+			Prefix:  fmt.Sprintf("%s/%d", net.IP(ipBytes).String(), ipv6Bits-alignBits),
 			Country: cc,
 		})
 
-		cur += uint32(1) << (32 - prefix)
+		cur.Add(cur, blockSize)
 	}
 
 	return out
@@ -131,14 +229,17 @@ func ipv6ToCIDR(start, value, cc string) (Record, bool) {
 	}, true
 }
 
-func ipToUint32(ip net.IP) uint32 {
+// IPToUint32 converts a 4-byte IPv4 address to its big-endian uint32
+// representation.
+func IPToUint32(ip net.IP) uint32 {
 	return uint32(ip[0])<<24 |
 		uint32(ip[1])<<16 |
 		uint32(ip[2])<<8 |
 		uint32(ip[3])
 }
 
-func uint32ToIP(v uint32) string {
+// Uint32ToIP formats v as a dotted-quad IPv4 address.
+func Uint32ToIP(v uint32) string {
 	return fmt.Sprintf("%d.%d.%d.%d",
 		byte(v>>24),
 		byte(v>>16),
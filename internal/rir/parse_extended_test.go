@@ -0,0 +1,37 @@
+package rir
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDelegatedExtended(t *testing.T) {
+	const data = `# comment line, skipped
+rir|US|ipv4|1.2.3.0|256|20200101|allocated
+rir|CA|ipv6|2001:db8::|32|20200101|assigned
+rir|DE|asn|64512|4|20200101|allocated
+rir|ZZ|ipv4|9.9.9.0|256|20200101|allocated
+rir|FR|ipv4|8.8.8.0|256|20200101|reserved
+`
+
+	recs, asnRecs, err := ParseDelegatedExtended(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("ParseDelegatedExtended returned error: %v", err)
+	}
+
+	wantRecs := []Record{
+		{Prefix: "1.2.3.0/24", Country: "US"},
+		{Prefix: "2001:db8::/32", Country: "CA"},
+	}
+	if !reflect.DeepEqual(recs, wantRecs) {
+		t.Errorf("recs = %v, want %v", recs, wantRecs)
+	}
+
+	wantASN := []ASNRecord{
+		{ASN: 64512, Count: 4, Country: "DE"},
+	}
+	if !reflect.DeepEqual(asnRecs, wantASN) {
+		t.Errorf("asnRecs = %v, want %v", asnRecs, wantASN)
+	}
+}
@@ -0,0 +1,69 @@
+package rir
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestIPv4RangeToCIDRs(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    string
+		end      string
+		cc       string
+		wantCIDR []string
+	}{
+		{
+			name:     "single /24",
+			start:    "1.2.3.0",
+			end:      "1.2.3.255",
+			cc:       "US",
+			wantCIDR: []string{"1.2.3.0/24"},
+		},
+		{
+			name:     "unaligned range needs multiple blocks",
+			start:    "1.2.3.0",
+			end:      "1.2.3.191", // /25 + /26
+			cc:       "US",
+			wantCIDR: []string{"1.2.3.0/25", "1.2.3.128/26"},
+		},
+		{
+			name:     "single address",
+			start:    "10.0.0.5",
+			end:      "10.0.0.5",
+			cc:       "CA",
+			wantCIDR: []string{"10.0.0.5/32"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			startU := IPToUint32(mustParseIPv4(t, tt.start))
+			endU := IPToUint32(mustParseIPv4(t, tt.end))
+
+			recs := IPv4RangeToCIDRs(startU, endU, tt.cc)
+
+			var got []string
+			for _, r := range recs {
+				got = append(got, r.Prefix)
+				if r.Country != tt.cc {
+					t.Errorf("record %s: country = %q, want %q", r.Prefix, r.Country, tt.cc)
+				}
+			}
+
+			if !reflect.DeepEqual(got, tt.wantCIDR) {
+				t.Errorf("IPv4RangeToCIDRs(%s, %s) = %v, want %v", tt.start, tt.end, got, tt.wantCIDR)
+			}
+		})
+	}
+}
+
+func mustParseIPv4(t *testing.T, s string) net.IP {
+	t.Helper()
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		t.Fatalf("invalid IPv4 address %q", s)
+	}
+	return ip
+}
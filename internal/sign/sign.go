@@ -0,0 +1,56 @@
+// Package sign implements Ed25519 signing and verification for release
+// manifests, so consumers of a deflect-geoip release can trust
+// latest.json end-to-end rather than relying on transport security
+// alone.
+package sign
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Signature is the value embedded in a release manifest. It covers the
+// canonical JSON encoding of the manifest with this field itself
+// omitted (zero-valued), so recomputing it requires clearing Signature
+// first.
+type Signature struct {
+	KeyID     string `json:"key_id"`
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"value"`
+}
+
+// Canonical returns the deterministic JSON encoding used as the signed
+// payload: compact (no indentation) and with map keys sorted, which is
+// what encoding/json already guarantees.
+func Canonical(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Sign signs payload with priv and returns a Signature tagged with
+// keyID, identifying which pinned public key a verifier should use.
+func Sign(priv ed25519.PrivateKey, keyID string, payload []byte) Signature {
+	sig := ed25519.Sign(priv, payload)
+	return Signature{
+		KeyID:     keyID,
+		Algorithm: "ed25519",
+		Value:     base64.StdEncoding.EncodeToString(sig),
+	}
+}
+
+// Verify reports whether sig is a valid Ed25519 signature over payload
+// under pub.
+func Verify(pub ed25519.PublicKey, payload []byte, sig Signature) error {
+	if sig.Algorithm != "ed25519" {
+		return fmt.Errorf("sign: unsupported algorithm %q", sig.Algorithm)
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return fmt.Errorf("sign: decoding signature: %w", err)
+	}
+	if !ed25519.Verify(pub, payload, raw) {
+		return fmt.Errorf("sign: signature verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package sign
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"testing"
+)
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(`{"version":"2024-01-01"}`)
+	sig := Sign(priv, "test-key", payload)
+
+	if err := Verify(pub, payload, sig); err != nil {
+		t.Errorf("Verify() of a freshly signed payload returned error: %v", err)
+	}
+}
+
+func TestVerifyRejectsTamperedPayload(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sig := Sign(priv, "test-key", []byte(`{"version":"2024-01-01"}`))
+
+	if err := Verify(pub, []byte(`{"version":"2024-01-02"}`), sig); err == nil {
+		t.Fatal("Verify() of a tampered payload = nil error, want error")
+	}
+}
+
+func TestVerifyRejectsWrongKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(`{"version":"2024-01-01"}`)
+	sig := Sign(priv, "test-key", payload)
+
+	if err := Verify(otherPub, payload, sig); err == nil {
+		t.Fatal("Verify() under the wrong public key = nil error, want error")
+	}
+}
+
+func TestVerifyRejectsUnsupportedAlgorithm(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := Sign(priv, "test-key", []byte("payload"))
+	sig.Algorithm = "rsa"
+
+	if err := Verify(pub, []byte("payload"), sig); err == nil {
+		t.Fatal("Verify() with an unsupported algorithm = nil error, want error")
+	}
+}
+
+func TestVerifyRejectsGarbageSignatureValue(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := Signature{KeyID: "test-key", Algorithm: "ed25519", Value: "not-base64!!"}
+
+	if err := Verify(pub, []byte("payload"), sig); err == nil {
+		t.Fatal("Verify() with a non-base64 signature value = nil error, want error")
+	}
+}
+
+// TestCanonicalRoundTripsThroughSignature mirrors how
+// cmd/build-countrydb signs and later verifies a manifest: Canonical is
+// computed with Signature unset, the struct is marshaled with Signature
+// now populated, and a verifier must be able to unmarshal it, clear
+// Signature again, and recompute the exact same canonical bytes that
+// were actually signed.
+func TestCanonicalRoundTripsThroughSignature(t *testing.T) {
+	type manifest struct {
+		Version   string     `json:"version"`
+		Signature *Signature `json:"signature,omitempty"`
+	}
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := manifest{Version: "2024-01-01"}
+	payload, err := Canonical(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := Sign(priv, "test-key", payload)
+	m.Signature = &sig
+
+	signed, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded manifest
+	if err := json.Unmarshal(signed, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	gotSig := *decoded.Signature
+	decoded.Signature = nil
+
+	recomputed, err := Canonical(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(recomputed) != string(payload) {
+		t.Fatalf("recomputed canonical payload = %s, want %s", recomputed, payload)
+	}
+
+	if err := Verify(pub, recomputed, gotSig); err != nil {
+		t.Errorf("Verify() of the round-tripped manifest returned error: %v", err)
+	}
+}
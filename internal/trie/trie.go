@@ -0,0 +1,118 @@
+// Package trie implements an in-memory longest-prefix-match index for
+// IPv4/IPv6 CIDR prefixes, used to answer country lookups without
+// depending on a third-party GeoIP library.
+package trie
+
+import (
+	"fmt"
+	"net"
+)
+
+// node is a single bit-level step in the binary trie. children[0] is the
+// branch for a 0 bit, children[1] for a 1 bit.
+type node struct {
+	children [2]*node
+	prefix   string
+	country  string
+	leaf     bool
+}
+
+// Trie is a longest-prefix-match index over IPv4 and IPv6 CIDR prefixes.
+// IPv4 and IPv6 addresses are kept in separate trees since they are
+// never ambiguous with one another.
+type Trie struct {
+	root4 *node
+	root6 *node
+	size  int
+}
+
+// New returns an empty Trie.
+func New() *Trie {
+	return &Trie{root4: &node{}, root6: &node{}}
+}
+
+// Insert adds a CIDR prefix ("1.2.3.0/24" or "2001:db8::/32") with its
+// associated country code to the trie.
+func (t *Trie) Insert(cidr, country string) error {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("trie: invalid prefix %q: %w", cidr, err)
+	}
+
+	ip4 := ipnet.IP.To4()
+	root := t.root6
+	bits := ipToBits(ipnet.IP.To16())
+	if ip4 != nil {
+		root = t.root4
+		bits = ipToBits(ip4)
+	}
+
+	ones, _ := ipnet.Mask.Size()
+	cur := root
+	for i := 0; i < ones; i++ {
+		b := bits[i]
+		if cur.children[b] == nil {
+			cur.children[b] = &node{}
+		}
+		cur = cur.children[b]
+	}
+	cur.leaf = true
+	cur.country = country
+	cur.prefix = cidr
+	t.size++
+	return nil
+}
+
+// Lookup returns the country and matching CIDR prefix for ip, using the
+// longest (most specific) prefix that covers it.
+func (t *Trie) Lookup(ip string) (country, prefix string, ok bool) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return "", "", false
+	}
+
+	ip4 := parsed.To4()
+	root := t.root6
+	bits := ipToBits(parsed.To16())
+	if ip4 != nil {
+		root = t.root4
+		bits = ipToBits(ip4)
+	}
+
+	var lastMatch *node
+	cur := root
+	for _, b := range bits {
+		if cur.leaf {
+			lastMatch = cur
+		}
+		if cur.children[b] == nil {
+			break
+		}
+		cur = cur.children[b]
+	}
+	if cur.leaf {
+		lastMatch = cur
+	}
+
+	if lastMatch == nil {
+		return "", "", false
+	}
+	return lastMatch.country, lastMatch.prefix, true
+}
+
+// Len returns the number of prefixes inserted into the trie.
+func (t *Trie) Len() int {
+	return t.size
+}
+
+// ipToBits expands a 4 or 16 byte IP into one bit per slice element, most
+// significant bit first, so the trie can be walked one level per bit.
+func ipToBits(ip net.IP) []byte {
+	bits := make([]byte, 0, len(ip)*8)
+	for _, b := range ip {
+		for i := 7; i >= 0; i-- {
+			bits = append(bits, (b>>uint(i))&1)
+		}
+	}
+	return bits
+}
@@ -0,0 +1,70 @@
+package trie
+
+import "testing"
+
+func TestLookupLongestPrefixMatch(t *testing.T) {
+	tr := New()
+	mustInsert(t, tr, "1.2.0.0/16", "US")
+	mustInsert(t, tr, "1.2.3.0/24", "CA")
+
+	tests := []struct {
+		ip          string
+		wantCountry string
+		wantPrefix  string
+		wantOK      bool
+	}{
+		{"1.2.3.5", "CA", "1.2.3.0/24", true}, // nested, more-specific prefix wins
+		{"1.2.9.5", "US", "1.2.0.0/16", true}, // falls back to the broader prefix
+		{"8.8.8.8", "", "", false},            // no covering prefix at all
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			country, prefix, ok := tr.Lookup(tt.ip)
+			if ok != tt.wantOK || country != tt.wantCountry || prefix != tt.wantPrefix {
+				t.Errorf("Lookup(%s) = (%q, %q, %v), want (%q, %q, %v)",
+					tt.ip, country, prefix, ok, tt.wantCountry, tt.wantPrefix, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestInsertRejectsInvalidCIDR(t *testing.T) {
+	tr := New()
+	if err := tr.Insert("not-a-cidr", "US"); err == nil {
+		t.Fatal("Insert() with an invalid CIDR = nil error, want error")
+	}
+}
+
+func TestIPv4AndIPv6AreSeparateTrees(t *testing.T) {
+	tr := New()
+	mustInsert(t, tr, "2001:db8::/32", "DE")
+
+	if _, _, ok := tr.Lookup("1.2.3.4"); ok {
+		t.Fatal("Lookup(1.2.3.4) matched an IPv6-only trie")
+	}
+
+	country, prefix, ok := tr.Lookup("2001:db8::1")
+	if !ok || country != "DE" || prefix != "2001:db8::/32" {
+		t.Errorf("Lookup(2001:db8::1) = (%q, %q, %v), want (%q, %q, true)",
+			country, prefix, ok, "DE", "2001:db8::/32")
+	}
+}
+
+func TestLenCountsInsertedPrefixes(t *testing.T) {
+	tr := New()
+	mustInsert(t, tr, "1.2.0.0/16", "US")
+	mustInsert(t, tr, "1.2.3.0/24", "CA")
+	mustInsert(t, tr, "2001:db8::/32", "DE")
+
+	if got := tr.Len(); got != 3 {
+		t.Errorf("Len() = %d, want 3", got)
+	}
+}
+
+func mustInsert(t *testing.T, tr *Trie, cidr, country string) {
+	t.Helper()
+	if err := tr.Insert(cidr, country); err != nil {
+		t.Fatalf("Insert(%q, %q) returned error: %v", cidr, country, err)
+	}
+}